@@ -0,0 +1,65 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// casSink stores each blob under its own content hash instead of its blob
+// index, so identical blob contents dedupe for free across runs and
+// machines. dir holds one file per blob, named by hex sha256; Finalize
+// records each blob's hash back into the manifest. hashes is keyed by blob
+// index rather than append order, since a resumed run only opens/closes the
+// blobs from its own lifetime while m.Blobs accumulates across all runs.
+type casSink struct {
+	dir    string
+	hashes []casBlobHash
+}
+
+type casBlobHash struct {
+	index int
+	hash  string
+}
+
+func newCASSink(dir string) *casSink {
+	return &casSink{dir: dir}
+}
+
+type casBlobWriter struct {
+	sink  *casSink
+	index int
+	h     hash.Hash
+	buf   []byte
+}
+
+func (w *casBlobWriter) Write(p []byte) (int, error) {
+	w.h.Write(p)
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *casBlobWriter) Close() error {
+	sum := hex.EncodeToString(w.h.Sum(nil))
+	w.sink.hashes = append(w.sink.hashes, casBlobHash{index: w.index, hash: sum})
+	return os.WriteFile(fmt.Sprintf("%s/%s.blob", w.sink.dir, sum), w.buf, 0644)
+}
+
+func (s *casSink) OpenBlob(index int) (io.WriteCloser, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, err
+	}
+	return &casBlobWriter{sink: s, index: index, h: sha256.New()}, nil
+}
+
+func (s *casSink) Finalize(m *manifest) error {
+	for _, bh := range s.hashes {
+		if bh.index < len(m.Blobs) {
+			m.Blobs[bh.index].ContentHash = bh.hash
+		}
+	}
+	return nil
+}
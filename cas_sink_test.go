@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+// TestCASSinkFinalizeAttributesHashByBlobIndex guards against regressing to
+// the old append-order zip: a resumed run only opens/closes the blobs from
+// its own lifetime, while m.Blobs already has entries from earlier runs.
+func TestCASSinkFinalizeAttributesHashByBlobIndex(t *testing.T) {
+	sink := newCASSink(t.TempDir())
+
+	// Blob 0's manifest entry is left over from a prior run; this process
+	// only opens and closes blob 1.
+	m := &manifest{Blobs: []blobRange{{}, {}}}
+
+	w, err := sink.OpenBlob(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("blob-1-bytes")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Finalize(m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Blobs[0].ContentHash != "" {
+		t.Fatalf("blob 0's ContentHash was touched: %q", m.Blobs[0].ContentHash)
+	}
+	if m.Blobs[1].ContentHash == "" {
+		t.Fatal("blob 1's ContentHash was not set")
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "time"
+
+// Clock abstracts time so long-running downloads can be driven
+// deterministically in tests, mirroring the approach used by Lotus's
+// build.Clock.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	Since(t time.Time) time.Duration
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                 { return time.Now() }
+func (systemClock) Sleep(d time.Duration)           { time.Sleep(d) }
+func (systemClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// clock is the Clock used throughout the program. Tests may swap it for a
+// mock.
+var clock Clock = systemClock{}
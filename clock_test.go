@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose Now only advances when Sleep is called,
+// letting tests drive time deterministically instead of racing the wall
+// clock.
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time                 { return f.now }
+func (f *fakeClock) Sleep(d time.Duration)           { f.now = f.now.Add(d) }
+func (f *fakeClock) Since(t time.Time) time.Duration { return f.now.Sub(t) }
+
+// withFakeClock swaps the package-level clock for a fakeClock for the
+// duration of the test, restoring the original afterward.
+func withFakeClock(t *testing.T, now time.Time) *fakeClock {
+	t.Helper()
+	prev := clock
+	fc := &fakeClock{now: now}
+	clock = fc
+	t.Cleanup(func() { clock = prev })
+	return fc
+}
+
+func TestParseDateRelative(t *testing.T) {
+	now := time.Date(2026, 7, 29, 12, 0, 0, 0, time.UTC)
+	withFakeClock(t, now)
+
+	tests := []struct {
+		date string
+		want time.Time
+	}{
+		{"now", now},
+		{"-1h", now.Add(-time.Hour)},
+		{"-1d", now.Add(-24 * time.Hour)},
+		{"-2m", now.Add(-60 * 24 * time.Hour)},
+		{"-1y", now.Add(-365 * 24 * time.Hour)},
+	}
+
+	for _, tt := range tests {
+		if got, want := parseDate(tt.date), uint64(tt.want.Unix()); got != want {
+			t.Errorf("parseDate(%q) = %d, want %d", tt.date, got, want)
+		}
+	}
+}
+
+func TestProgressReporterSkipsUpdateOnCanceledContext(t *testing.T) {
+	now := time.Date(2026, 7, 29, 12, 0, 0, 0, time.UTC)
+	fc := withFakeClock(t, now)
+
+	r := progressReporter{n: 100, clock: fc, lastReportTime: now}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r.update(ctx, 50, "blocks")
+
+	if r.pct != 0 {
+		t.Errorf("pct = %d, want 0 (update should have been skipped on a canceled context)", r.pct)
+	}
+}
+
+// TestWithRetryRetriesTransientErrorsThenSucceeds checks that withRetry
+// retries a failing fn with backoff (driven by the fake clock, not real
+// sleeps) and returns nil once fn starts succeeding.
+func TestWithRetryRetriesTransientErrorsThenSucceeds(t *testing.T) {
+	now := time.Date(2026, 7, 29, 12, 0, 0, 0, time.UTC)
+	withFakeClock(t, now)
+
+	var calls int
+	err := withRetry(context.Background(), nil, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("withRetry: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("fn called %d times, want 3", calls)
+	}
+	if got, want := clock.Now().Sub(now), 1500*time.Millisecond; got != want {
+		t.Errorf("fake clock advanced by %v, want %v (500ms + 1s backoff)", got, want)
+	}
+}
+
+// TestWithRetryGivesUpAfterMaxAttempts checks that withRetry stops retrying
+// and returns the last error once it has tried maxAttempts times.
+func TestWithRetryGivesUpAfterMaxAttempts(t *testing.T) {
+	withFakeClock(t, time.Date(2026, 7, 29, 12, 0, 0, 0, time.UTC))
+
+	var calls int
+	err := withRetry(context.Background(), nil, func() error {
+		calls++
+		return errors.New("permanent")
+	})
+
+	if err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+	if calls != 5 {
+		t.Fatalf("fn called %d times, want 5 (maxAttempts)", calls)
+	}
+}
+
+func TestRateLimiterUsesClockNotWallTime(t *testing.T) {
+	now := time.Date(2026, 7, 29, 12, 0, 0, 0, time.UTC)
+	withFakeClock(t, now)
+
+	r := newRateLimiter(10) // one slot every 100ms
+	ctx := context.Background()
+
+	if err := r.wait(ctx); err != nil {
+		t.Fatalf("first wait: %v", err)
+	}
+	if err := r.wait(ctx); err != nil {
+		t.Fatalf("second wait: %v", err)
+	}
+
+	if got, want := clock.Now().Sub(now), 100*time.Millisecond; got != want {
+		t.Errorf("fake clock advanced by %v, want %v", got, want)
+	}
+}
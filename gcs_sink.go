@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// gcsSink uploads each blob to a GCS bucket as object prefix+index+".blob"
+// once the blob is closed, the same buffer-then-upload approach as s3Sink.
+type gcsSink struct {
+	ctx    context.Context
+	client *storage.Client
+	bucket string
+	prefix string
+}
+
+func newGCSSink(ctx context.Context, bucket, prefix string) (*gcsSink, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCS client: %w", err)
+	}
+	return &gcsSink{ctx: ctx, client: client, bucket: bucket, prefix: prefix}, nil
+}
+
+type gcsBlobWriter struct {
+	sink *gcsSink
+	key  string
+	buf  bytes.Buffer
+}
+
+func (w *gcsBlobWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *gcsBlobWriter) Close() error {
+	obj := w.sink.client.Bucket(w.sink.bucket).Object(w.key).NewWriter(w.sink.ctx)
+	if _, err := obj.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	return obj.Close()
+}
+
+func (s *gcsSink) OpenBlob(index int) (io.WriteCloser, error) {
+	return &gcsBlobWriter{sink: s, key: fmt.Sprintf("%s%d.blob", s.prefix, index)}, nil
+}
+
+func (s *gcsSink) Finalize(*manifest) error {
+	return s.client.Close()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// localSink writes blobs as plain files named prefix+index+".blob", the
+// original behavior before BlobSink existed.
+type localSink struct {
+	prefix string
+}
+
+func newLocalSink(prefix string) *localSink {
+	return &localSink{prefix: prefix}
+}
+
+func (s *localSink) name(index int) string {
+	return fmt.Sprintf("%s%d.blob", s.prefix, index)
+}
+
+// OpenBlob opens the file without truncating it, so a blob that already has
+// bytes on disk (because we're resuming) is appended to rather than
+// overwritten.
+func (s *localSink) OpenBlob(index int) (io.WriteCloser, error) {
+	file, err := os.OpenFile(s.name(index), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (s *localSink) ReadBlob(index int) ([]byte, error) {
+	return os.ReadFile(s.name(index))
+}
+
+func (s *localSink) Finalize(*manifest) error {
+	return nil
+}
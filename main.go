@@ -4,15 +4,18 @@ import (
 	"cmp"
 	"context"
 	"crypto/rand"
+	"errors"
 	"flag"
 	"fmt"
-	v1 "github.com/consensys/linea-monorepo/prover/lib/compressor/blob/v1"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"golang.org/x/exp/constraints"
 	"math/big"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -21,14 +24,17 @@ var (
 	flagEndDate   = flag.String("end-date", "now", "End date for blocks (start with - for relative to now)")
 	flagUrl       = flag.String("url", "http://localhost:8545", "RPC URL")
 	flagSize      = flag.Uint("max", 0, "Maximum size of randomly chosen blocks in MB. If 0, all blocks are written in succession.")
-	flagOut       = flag.String("out", "blocks/", "Output file prefix for blocks. It will be written as blobs, with names consisting of a number appended to the argument.")
+	flagOut       = flag.String("out", "blocks/", "Output prefix for blocks, written as blobs with a number appended to the argument. A bare path or file:// writes to local disk; s3://bucket/prefix, gs://bucket/prefix, and cas://dir select other BlobSink backends.")
+	flagManifest  = flag.String("manifest", "", "Local directory manifest.json is checkpointed in. Defaults to --out itself for local disk and cas:// backends, or a derived local cache directory for s3:// and gs://, since the manifest is always read and written on local disk.")
 	flagBlobSize  = flag.Uint("blobsize", 131072, "Size of each blob in bytes")
+	flagWorkers   = flag.Uint("workers", 1, "Number of concurrent RPC workers used to fetch blocks")
+	flagRateLimit = flag.Float64("rate-limit", 0, "Maximum RPC requests per second across all workers (0 = unlimited)")
 	client        *ethclient.Client
 )
 
 // parseDate parses a date either in the format YYYY-MM-DD, or as a relative date, now, or in the past(e.g., -30d, -2m).
 func parseDate(date string) uint64 {
-	now := uint64(time.Now().Unix())
+	now := uint64(clock.Now().Unix())
 	if strings.ToLower(date) == "now" {
 		return now
 	}
@@ -75,103 +81,149 @@ func binarySearchF[T constraints.Integer](lower, upper T, increasingF func(T) in
 	return lower
 }
 
-func findBlockByDate(date uint64) int64 {
-	currentBlock, err := client.HeaderByNumber(context.Background(), nil)
-	assertNoError(err)
-	return binarySearchF(0, currentBlock.Number.Int64(), func(blockNumber int64) int {
-		header, err := client.HeaderByNumber(context.Background(), big.NewInt(blockNumber))
-		assertNoError(err)
+// findBlockByDate resolves date to a block number via binary search over
+// block headers, retrying each RPC call with the same backoff as block
+// fetches so a transient error doesn't crash the tool at startup.
+func findBlockByDate(ctx context.Context, date uint64) (int64, error) {
+	var currentBlock *types.Header
+	if err := withRetry(ctx, nil, func() error {
+		var err error
+		currentBlock, err = client.HeaderByNumber(ctx, nil)
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	var rpcErr error
+	result := binarySearchF(0, currentBlock.Number.Int64(), func(blockNumber int64) int {
+		if rpcErr != nil {
+			return 0
+		}
+		var header *types.Header
+		err := withRetry(ctx, nil, func() error {
+			var err error
+			header, err = client.HeaderByNumber(ctx, big.NewInt(blockNumber))
+			return err
+		})
+		if err != nil {
+			rpcErr = err
+			return 0
+		}
 		return cmp.Compare(header.Time, date)
 	})
+	if rpcErr != nil {
+		return 0, rpcErr
+	}
+	return result, nil
 }
 
 func main() {
 	flag.Parse()
 
-	var err error
-	client, err = ethclient.Dial(*flagUrl)
+	if *flagWorkers < 1 {
+		assertNoError(fmt.Errorf("--workers must be at least 1, got %d", *flagWorkers))
+	}
+
+	// Cancel cleanly on Ctrl-C: an in-flight client.BlockByNumber aborts,
+	// the current blob is flushed, and the manifest reflects the last
+	// fully-written block.
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	err := withRetry(ctx, nil, func() error {
+		var err error
+		client, err = ethclient.Dial(*flagUrl)
+		return err
+	})
 	assertNoError(err)
 
-	startNum := findBlockByDate(parseDate(*flagStartDate))
-	endNum := findBlockByDate(parseDate(*flagEndDate))
+	var chainID *big.Int
+	err = withRetry(ctx, nil, func() error {
+		var err error
+		chainID, err = client.ChainID(ctx)
+		return err
+	})
+	assertNoError(err)
 
-	var reporter progressReporter
+	startNum, err := findBlockByDate(ctx, parseDate(*flagStartDate))
+	assertNoError(err)
+	endNum, err := findBlockByDate(ctx, parseDate(*flagEndDate))
+	assertNoError(err)
 
-	out := newWriterWithCounter(*flagOut, *flagBlobSize)
+	manifestNamePrefix := manifestPrefix(*flagOut, *flagManifest)
+	m := loadManifest(manifestNamePrefix, *flagUrl, chainID.Uint64(), startNum, endNum, *flagBlobSize)
 
-	writeBlock := func(blockNum *big.Int) {
-		block, err := client.BlockByNumber(context.Background(), blockNum)
-		assertNoError(err)
-		assertNoError(v1.EncodeBlockForCompression(block, out))
+	reporter := progressReporter{clock: clock}
+
+	// Object-store sinks upload a blob on Close using this context, so it
+	// must outlive Ctrl-C for the final flush in out.Close() to succeed.
+	sink, err := newBlobSink(context.WithoutCancel(ctx), *flagOut)
+	assertNoError(err)
+	out := newWriterWithCounter(sink, manifestNamePrefix, *flagBlobSize, m)
+
+	limiter := newRateLimiter(*flagRateLimit)
+	fetch := func(ctx context.Context, num int64) (*types.Block, error) {
+		return fetchWithRetry(ctx, big.NewInt(num), limiter)
 	}
 
 	maxSize := *flagSize * 1024 * 1024
 
+	var pipelineErr error
 	if maxSize > 0 {
 		reporter.n = maxSize
 
 		span := big.NewInt(endNum - startNum)
-		startNum := big.NewInt(startNum)
+		base := big.NewInt(startNum)
 
-		for out.Written() < maxSize {
+		next := func() (int64, bool) {
+			if out.Written() >= maxSize {
+				return 0, false
+			}
 			blockNum, err := rand.Int(rand.Reader, span)
 			assertNoError(err)
-			writeBlock(blockNum.Add(blockNum, startNum))
-
-			reporter.update(out.Written(), "bytes")
-
+			return blockNum.Add(blockNum, base).Int64(), true
 		}
+
+		pipelineErr = runPipeline(ctx, *flagWorkers, false, startNum, next, fetch, func(num int64, block *types.Block) error {
+			if err := out.WriteBlock(num, block); err != nil {
+				return err
+			}
+			reporter.update(ctx, out.Written(), "bytes")
+			return nil
+		})
 	} else {
 		reporter.n = uint(endNum - startNum)
 
-		for i := startNum; i < endNum; i++ {
-			writeBlock(big.NewInt(i))
-			reporter.update(uint(i-startNum), "blocks")
+		// Resume past whatever the manifest already recorded as done.
+		resumeFrom := startNum
+		if m.LastBlock+1 > resumeFrom {
+			resumeFrom = m.LastBlock + 1
+		}
+		firstNum := resumeFrom
+
+		next := func() (int64, bool) {
+			if resumeFrom >= endNum {
+				return 0, false
+			}
+			num := resumeFrom
+			resumeFrom++
+			return num, true
 		}
-	}
-}
-
-type writer struct {
-	file *os.File
-	n    uint
-
-	blobW0     uint // starting point for current blob
-	blobI      uint
-	namePrefix string
-	blobSize   uint
-}
-
-func newWriterWithCounter(namePrefix string, blobSize uint) *writer {
-	file, err := os.Create(namePrefix + "0.blob")
-	assertNoError(err)
-
-	return &writer{file: file, namePrefix: namePrefix, blobSize: blobSize}
-}
 
-func (w *writer) Write(p []byte) (n int, err error) {
-	n, err = w.file.Write(p)
-	if err != nil {
-		return
+		pipelineErr = runPipeline(ctx, *flagWorkers, true, firstNum, next, fetch, func(num int64, block *types.Block) error {
+			if err := out.WriteBlock(num, block); err != nil {
+				return err
+			}
+			reporter.update(ctx, uint(num-startNum), "blocks")
+			return nil
+		})
 	}
-	w.n += uint(n)
 
-	if w.n-w.blobW0 >= w.blobSize {
-		w.blobW0 = w.n
-		w.blobI++
-		assertNoError(w.file.Close())
-		w.file, err = os.Create(fmt.Sprintf("%s%d.blob", w.namePrefix, w.blobI))
-		assertNoError(err)
+	if pipelineErr != nil && !errors.Is(pipelineErr, context.Canceled) {
+		assertNoError(pipelineErr)
 	}
 
-	return
-}
-
-func (w *writer) Written() uint {
-	return w.n
-}
-
-func (w *writer) Close() {
-	assertNoError(w.file.Close())
+	out.Close()
 }
 
 func assertNoError(err error) {
@@ -181,24 +233,25 @@ func assertNoError(err error) {
 }
 
 type progressReporter struct {
-	n              uint  // max value
-	pct            uint  // current percentage
-	lastReportTime int64 // last time reported
+	n              uint      // max value
+	pct            uint      // current percentage
+	lastReportTime time.Time // last time reported
+	clock          Clock
 }
 
-func newProgressReporter(n uint) *progressReporter {
-	return &progressReporter{n: n, lastReportTime: time.Now().Unix()}
-}
+func (r *progressReporter) update(ctx context.Context, i uint, objectName string) {
+	if ctx.Err() != nil {
+		return
+	}
 
-func (r *progressReporter) update(i uint, objectName string) {
 	newPct := i * 100 / r.n
-	now := time.Now().Unix()
-	if newPct != r.pct || now-r.lastReportTime > 30 {
+	now := r.clock.Now()
+	if newPct != r.pct || r.clock.Since(r.lastReportTime) > 30*time.Second {
 		of := ""
 		if objectName != "" {
 			of = fmt.Sprintf(" of %s", objectName)
 		}
-		fmt.Printf("%s %d%%%s (%d/%d)\n", time.Now().Format("2006-01-02 15:04:05"), newPct, of, i, r.n)
+		fmt.Printf("%s %d%%%s (%d/%d)\n", now.Format("2006-01-02 15:04:05"), newPct, of, i, r.n)
 	}
 	r.pct = newPct
 	r.lastReportTime = now
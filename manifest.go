@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// blobRange records the byte and block-number extent of a single .blob file.
+type blobRange struct {
+	ByteStart   uint   `json:"byteStart"`
+	ByteEnd     uint   `json:"byteEnd"`
+	BlockStart  int64  `json:"blockStart"`
+	BlockEnd    int64  `json:"blockEnd"`
+	BlockCount  int    `json:"blockCount"` // number of whole blocks encoded into this blob
+	ContentHash string `json:"contentHash,omitempty"`
+}
+
+// manifest is written to manifest.json under the local prefix chosen by
+// manifestPrefix (alongside the blobs when --out is on local disk), so an
+// interrupted download can be resumed instead of restarting from scratch.
+type manifest struct {
+	RPCURL     string      `json:"rpcUrl"`
+	ChainID    uint64      `json:"chainId"`
+	StartBlock int64       `json:"startBlock"`
+	EndBlock   int64       `json:"endBlock"`
+	BlobSize   uint        `json:"blobSize"`
+	Blobs      []blobRange `json:"blobs"`
+	Hash       string      `json:"hash"`      // hex sha256 of all encoded bytes written so far
+	LastBlock  int64       `json:"lastBlock"` // last block number fully appended, or startBlock-1
+}
+
+func manifestPath(namePrefix string) string {
+	return namePrefix + "manifest.json"
+}
+
+// manifestPrefix returns the local filesystem prefix manifest.json should be
+// checkpointed under. It must never be out itself when out names a remote
+// destination (s3://, gs://): manifestPath would then hand os.WriteFile a
+// URI instead of a path, and writer.checkpoint calls save() after every
+// block. manifestDir, when set via --manifest, always wins. Otherwise out is
+// used as-is for local disk and cas:// (whose host+path is already a real
+// local directory), and a cache directory derived from the URI is used for
+// everything else.
+func manifestPrefix(out, manifestDir string) string {
+	if manifestDir != "" {
+		return ensureTrailingSlash(manifestDir)
+	}
+
+	u, err := url.Parse(out)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 { // len==1: a Windows drive letter, not a scheme
+		return out
+	}
+
+	switch u.Scheme {
+	case "file", "cas":
+		return ensureTrailingSlash(u.Host + u.Path)
+	default:
+		dir := filepath.Join(".manifest-cache", u.Scheme, u.Host+u.Path)
+		assertNoError(os.MkdirAll(dir, 0755))
+		return ensureTrailingSlash(dir)
+	}
+}
+
+func ensureTrailingSlash(p string) string {
+	if p == "" || strings.HasSuffix(p, "/") {
+		return p
+	}
+	return p + "/"
+}
+
+// loadManifest reads namePrefix's manifest.json if one exists, otherwise
+// returns a fresh manifest seeded from the current run's parameters.
+func loadManifest(namePrefix, rpcURL string, chainID uint64, startBlock, endBlock int64, blobSize uint) *manifest {
+	data, err := os.ReadFile(manifestPath(namePrefix))
+	if os.IsNotExist(err) {
+		return &manifest{
+			RPCURL:     rpcURL,
+			ChainID:    chainID,
+			StartBlock: startBlock,
+			EndBlock:   endBlock,
+			BlobSize:   blobSize,
+			LastBlock:  startBlock - 1,
+		}
+	}
+	assertNoError(err)
+
+	m := &manifest{}
+	assertNoError(json.Unmarshal(data, m))
+
+	// The manifest's hash chain and resume point are only meaningful
+	// against the RPC endpoint and chain they were recorded against;
+	// resuming it against a different one (a failover node on a different
+	// chain, say) would silently mix blocks from two chains into one blob.
+	if m.RPCURL != rpcURL || m.ChainID != chainID {
+		assertNoError(fmt.Errorf("manifest at %s was recorded for rpcUrl=%q chainId=%d, but this run is using rpcUrl=%q chainId=%d; refusing to resume", manifestPath(namePrefix), m.RPCURL, m.ChainID, rpcURL, chainID))
+	}
+
+	return m
+}
+
+func (m *manifest) save(namePrefix string) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	assertNoError(err)
+	assertNoError(os.WriteFile(manifestPath(namePrefix), data, 0644))
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestManifestPrefixKeepsNonLocalOutOffLocalDisk guards against the
+// regression where a non-file:// --out was passed straight into
+// os.WriteFile/os.ReadFile as a literal path: manifestPrefix must always
+// resolve to something a local os.ReadFile/os.WriteFile can use.
+func TestManifestPrefixKeepsNonLocalOutOffLocalDisk(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+	}{
+		{"s3", "s3://my-bucket/prefix"},
+		{"gs", "gs://my-bucket/prefix"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix := manifestPrefix(tt.out, "")
+			if strings.Contains(prefix, "://") {
+				t.Fatalf("manifestPrefix(%q) = %q, still looks like a URI", tt.out, prefix)
+			}
+			if !filepath.IsLocal(strings.TrimSuffix(prefix, "/")) {
+				t.Fatalf("manifestPrefix(%q) = %q, not a local path", tt.out, prefix)
+			}
+		})
+	}
+}
+
+func TestManifestPrefixPassesThroughLocalAndCAS(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want string
+	}{
+		{"bare path", "blocks/", "blocks/"},
+		{"file scheme", "file://blocks/", "blocks/"},
+		{"cas scheme", "cas://cas-dir", "cas-dir/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := manifestPrefix(tt.out, ""); got != tt.want {
+				t.Errorf("manifestPrefix(%q) = %q, want %q", tt.out, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestPrefixExplicitManifestFlagWins(t *testing.T) {
+	if got, want := manifestPrefix("s3://bucket/prefix", "state"), "state/"; got != want {
+		t.Errorf("manifestPrefix with --manifest set = %q, want %q", got, want)
+	}
+}
+
+func mustRecover(t *testing.T, wantSubstr string) {
+	t.Helper()
+	r := recover()
+	if r == nil {
+		t.Fatal("expected loadManifest to panic, it did not")
+	}
+	if err, ok := r.(error); !ok || !strings.Contains(err.Error(), wantSubstr) {
+		t.Fatalf("panic value = %v, want an error containing %q", r, wantSubstr)
+	}
+}
+
+func TestLoadManifestRejectsRPCURLMismatch(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "state-")
+	loadManifest(prefix, "http://a", 1, 0, 100, 1<<20).save(prefix)
+
+	defer mustRecover(t, "rpcUrl")
+	loadManifest(prefix, "http://b", 1, 0, 100, 1<<20)
+}
+
+func TestLoadManifestRejectsChainIDMismatch(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "state-")
+	loadManifest(prefix, "http://a", 1, 0, 100, 1<<20).save(prefix)
+
+	defer mustRecover(t, "chainId")
+	loadManifest(prefix, "http://a", 2, 0, 100, 1<<20)
+}
+
+func TestLoadManifestAcceptsMatchingRPCURLAndChainID(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "state-")
+	loadManifest(prefix, "http://a", 1, 0, 100, 1<<20).save(prefix)
+
+	if m := loadManifest(prefix, "http://a", 1, 0, 200, 1<<20); m.RPCURL != "http://a" {
+		t.Fatalf("loadManifest panicked or returned unexpected manifest: %+v", m)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fetchResult is the outcome of fetching one block, produced by a worker and
+// consumed by the ordered writer stage.
+type fetchResult struct {
+	num   int64
+	block *types.Block
+	err   error
+}
+
+// resultHeap orders pending fetchResults by block number so the writer
+// stage can drain them in strictly ascending order even though workers
+// finish out of order.
+type resultHeap []fetchResult
+
+func (h resultHeap) Len() int           { return len(h) }
+func (h resultHeap) Less(i, j int) bool { return h[i].num < h[j].num }
+func (h resultHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap) Push(x any)        { *h = append(*h, x.(fetchResult)) }
+func (h *resultHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// rateLimiter caps the number of RPC requests issued per second across all
+// workers, by having each caller reserve the next free slot and sleep until
+// it arrives. A nil *rateLimiter imposes no limit. Routed through Clock
+// (rather than time.NewTicker) so it's deterministic under a fake clock in
+// tests.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (r *rateLimiter) wait(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	now := clock.Now()
+	if r.next.IsZero() || now.After(r.next) {
+		r.next = now
+	}
+	delay := r.next.Sub(now)
+	r.next = r.next.Add(r.interval)
+	r.mu.Unlock()
+
+	if delay > 0 {
+		clock.Sleep(delay)
+	}
+	return ctx.Err()
+}
+
+// withRetry calls fn, retrying transient errors with exponential backoff,
+// until it succeeds, ctx is canceled, or it has been tried maxAttempts
+// times. limiter may be nil to skip rate limiting (startup RPC calls aren't
+// worth limiting the way per-block fetches are).
+func withRetry(ctx context.Context, limiter *rateLimiter, fn func() error) error {
+	const maxAttempts = 5
+	backoff := 500 * time.Millisecond
+
+	for attempt := 1; ; attempt++ {
+		if err := limiter.wait(ctx); err != nil {
+			return err
+		}
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || attempt >= maxAttempts {
+			return err
+		}
+
+		clock.Sleep(backoff)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// fetchWithRetry calls client.BlockByNumber, retrying transient RPC errors
+// with exponential backoff.
+func fetchWithRetry(ctx context.Context, blockNum *big.Int, limiter *rateLimiter) (*types.Block, error) {
+	var block *types.Block
+	err := withRetry(ctx, limiter, func() error {
+		var err error
+		block, err = client.BlockByNumber(ctx, blockNum)
+		return err
+	})
+	return block, err
+}
+
+// runPipeline fans the block numbers produced by next out to workers
+// concurrent RPC calls, then passes the fetched blocks to consume.
+//
+// If ordered is true (the sequential download mode), consume always sees
+// strictly ascending block numbers even though workers may finish fetching
+// out of order, via a min-heap reorder buffer keyed by block number. This
+// keeps blocks appended to the blob in the order v1.DecodeBlockFromCompression
+// expects. When ordered is false (random sampling), consume just sees
+// whatever order the workers finish in, since sampled blocks have no
+// ordering requirement.
+//
+// next is only ever called from runPipeline's producer goroutine and consume
+// only from the goroutine that called runPipeline, so neither is called
+// concurrently with itself; next can run concurrently with consume.
+//
+// fetch retrieves the block for a given number; main() passes a closure
+// around fetchWithRetry and the rate limiter, keeping runPipeline itself
+// only concerned with fan-out and reordering.
+func runPipeline(ctx context.Context, workers uint, ordered bool, startNum int64, next func() (int64, bool), fetch func(ctx context.Context, num int64) (*types.Block, error), consume func(num int64, block *types.Block) error) error {
+	if workers < 1 {
+		return fmt.Errorf("runPipeline: workers must be at least 1, got %d", workers)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int64, workers)
+	results := make(chan fetchResult, workers)
+
+	var wg sync.WaitGroup
+	for i := uint(0); i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for num := range jobs {
+				block, err := fetch(ctx, num)
+				results <- fetchResult{num: num, block: block, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for {
+			num, ok := next()
+			if !ok {
+				return
+			}
+			select {
+			case jobs <- num:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// abort cancels ctx so the producer and any in-flight fetch calls unwind
+	// promptly, then drains results in the background so workers blocked
+	// sending on it can still finish and call wg.Done(), letting close(results)
+	// fire and the drain goroutine exit. Without this, returning early here
+	// would leak the producer and any blocked workers forever.
+	abort := func(err error) error {
+		cancel()
+		go func() {
+			for range results {
+			}
+		}()
+		return err
+	}
+
+	if !ordered {
+		for r := range results {
+			if r.err != nil {
+				return abort(r.err)
+			}
+			if err := consume(r.num, r.block); err != nil {
+				return abort(err)
+			}
+		}
+		return ctx.Err()
+	}
+
+	pq := &resultHeap{}
+	expected := startNum
+
+	for r := range results {
+		if r.err != nil {
+			return abort(r.err)
+		}
+		heap.Push(pq, r)
+
+		for pq.Len() > 0 && (*pq)[0].num == expected {
+			res := heap.Pop(pq).(fetchResult)
+			if err := consume(res.num, res.block); err != nil {
+				return abort(err)
+			}
+			expected++
+		}
+	}
+	return ctx.Err()
+}
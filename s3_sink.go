@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3Sink uploads each blob to an S3-compatible bucket as object
+// prefix+index+".blob" once the blob is closed. S3 objects can't be
+// appended to in place, so each blob is buffered in memory until Close.
+type s3Sink struct {
+	ctx    context.Context
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func newS3Sink(ctx context.Context, bucket, prefix string) (*s3Sink, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loading AWS config: %w", err)
+	}
+	return &s3Sink{ctx: ctx, client: s3.NewFromConfig(cfg), bucket: bucket, prefix: prefix}, nil
+}
+
+type s3BlobWriter struct {
+	sink *s3Sink
+	key  string
+	buf  bytes.Buffer
+}
+
+func (w *s3BlobWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *s3BlobWriter) Close() error {
+	_, err := w.sink.client.PutObject(w.sink.ctx, &s3.PutObjectInput{
+		Bucket: aws.String(w.sink.bucket),
+		Key:    aws.String(w.key),
+		Body:   bytes.NewReader(w.buf.Bytes()),
+	})
+	return err
+}
+
+func (s *s3Sink) OpenBlob(index int) (io.WriteCloser, error) {
+	return &s3BlobWriter{sink: s, key: fmt.Sprintf("%s%d.blob", s.prefix, index)}, nil
+}
+
+func (s *s3Sink) Finalize(*manifest) error {
+	return nil
+}
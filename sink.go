@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// BlobSink abstracts where blobs are written, so the writer's rotation and
+// manifest bookkeeping work the same whether blocks land on local disk or in
+// an object store.
+type BlobSink interface {
+	// OpenBlob opens blob number index for writing, creating it if needed.
+	OpenBlob(index int) (io.WriteCloser, error)
+	// Finalize is called once after the last blob has been closed, with the
+	// manifest as it stood at that point.
+	Finalize(m *manifest) error
+}
+
+// blobReader is implemented by sinks that can hand back bytes already
+// written to a blob, so the writer can rehash them when resuming. Only
+// localSink implements it: streaming/object-store sinks only commit a blob
+// once it's fully written, so there's nothing partial to read back, and the
+// writer instead re-derives that blob from scratch on resume.
+type blobReader interface {
+	ReadBlob(index int) ([]byte, error)
+}
+
+// newBlobSink selects a BlobSink from --out's URI scheme: file:// (or a bare
+// path) for local disk, s3:// for S3-compatible object storage, gs:// for
+// GCS, and cas:// for a content-addressed sink. manifest.json is always
+// checkpointed on local disk, at a path derived by manifestPrefix rather
+// than out itself, since out may not name anything on the local filesystem.
+func newBlobSink(ctx context.Context, out string) (BlobSink, error) {
+	u, err := url.Parse(out)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 { // len==1: a Windows drive letter, not a scheme
+		return newLocalSink(out), nil
+	}
+
+	switch u.Scheme {
+	case "file":
+		return newLocalSink(u.Host + u.Path), nil
+	case "s3":
+		return newS3Sink(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+	case "gs":
+		return newGCSSink(ctx, u.Host, strings.TrimPrefix(u.Path, "/"))
+	case "cas":
+		return newCASSink(u.Host + u.Path), nil
+	default:
+		return nil, fmt.Errorf("unsupported --out scheme %q", u.Scheme)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync/atomic"
+
+	v1 "github.com/consensys/linea-monorepo/prover/lib/compressor/blob/v1"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// writer rotates output across fixed-size blobs on out and keeps m up to
+// date so a download can be resumed after an interruption. n is an
+// atomic.Uint64 because the parallel pipeline's producer goroutine polls
+// Written() while the writer goroutine is still appending.
+type writer struct {
+	blob io.WriteCloser // current blob, opened via BlobSink.OpenBlob
+	n    atomic.Uint64
+
+	blobW0     uint // starting point for current blob
+	blobI      uint
+	blobSize   uint
+	out        BlobSink
+	namePrefix string // where manifest.json lives, independent of out
+
+	h              hash.Hash
+	blobBlockStart int64 // -1 once the current blob hasn't been given a block yet
+	curBlock       int64
+	m              *manifest
+}
+
+// newWriterWithCounter opens the blob sequence described by m on out,
+// resuming in place if m already has recorded progress. namePrefix is where
+// manifest.json is checkpointed; it's local disk regardless of out's kind.
+func newWriterWithCounter(out BlobSink, namePrefix string, blobSize uint, m *manifest) *writer {
+	w := &writer{out: out, namePrefix: namePrefix, blobSize: blobSize, h: sha256.New(), blobBlockStart: -1, curBlock: m.LastBlock, m: m}
+
+	if len(m.Blobs) == 0 {
+		file, err := out.OpenBlob(0)
+		assertNoError(err)
+		w.blob = file
+		return w
+	}
+
+	last := m.Blobs[len(m.Blobs)-1]
+	w.blobI = uint(len(m.Blobs) - 1)
+
+	if reader, ok := out.(blobReader); ok {
+		// The sink can hand back what's already durable, so rehash it and
+		// pick up exactly where the last run left off.
+		for i := 0; i <= int(w.blobI); i++ {
+			data, err := reader.ReadBlob(i)
+			assertNoError(err)
+			w.h.Write(data)
+		}
+		w.blobW0 = last.ByteStart
+		w.n.Store(uint64(last.ByteEnd))
+		w.blobBlockStart = last.BlockStart
+	} else {
+		// Streaming/object-store sinks only commit a blob once it's fully
+		// closed, so a crash mid-blob loses it entirely. Roll back to that
+		// blob's start and let main() re-fetch and re-encode its blocks
+		// into a fresh one.
+		m.Blobs = m.Blobs[:w.blobI]
+		m.LastBlock = last.BlockStart - 1
+		w.blobW0 = last.ByteStart
+		w.n.Store(uint64(last.ByteStart))
+	}
+
+	file, err := out.OpenBlob(int(w.blobI))
+	assertNoError(err)
+	w.blob = file
+
+	return w
+}
+
+// WriteBlock encodes block (block number blockNum) and appends it to the
+// current blob, rotating to a new blob first if the encoded block wouldn't
+// fit within blobSize. Rotation only ever happens between whole blocks, so
+// no .blob file ever ends mid-block and v1.DecodeBlockFromCompression can
+// decode any one of them in isolation.
+func (w *writer) WriteBlock(blockNum int64, block *types.Block) error {
+	var buf bytes.Buffer
+	if err := v1.EncodeBlockForCompression(block, &buf); err != nil {
+		return err
+	}
+
+	if w.blobBlockStart >= 0 && uint(w.n.Load())-w.blobW0+uint(buf.Len()) > w.blobSize {
+		w.rotate()
+	}
+	if w.blobBlockStart < 0 {
+		w.blobBlockStart = blockNum
+	}
+	w.curBlock = blockNum
+
+	if err := w.appendBytes(buf.Bytes()); err != nil {
+		return err
+	}
+
+	w.checkpoint(blockNum)
+	return nil
+}
+
+// appendBytes writes p to the current blob and folds it into the running
+// hash, without making any rotation decision of its own.
+func (w *writer) appendBytes(p []byte) error {
+	n, err := w.blob.Write(p)
+	if err != nil {
+		return err
+	}
+	w.h.Write(p[:n])
+	w.n.Add(uint64(n))
+	return nil
+}
+
+// checkpoint records blockNum as appended to the current blob and persists
+// the manifest, so the next run can resume immediately after it.
+//
+// BlockStart/BlockEnd are tracked as the true min/max of every blockNum
+// seen for this blob rather than the first/last call, since in --max
+// (random sampling) mode consume sees blocks in whatever order workers
+// finish fetching them, not ascending order.
+func (w *writer) checkpoint(blockNum int64) {
+	for len(w.m.Blobs) <= int(w.blobI) {
+		w.m.Blobs = append(w.m.Blobs, blobRange{ByteStart: w.blobW0, BlockStart: blockNum, BlockEnd: blockNum})
+	}
+	b := &w.m.Blobs[w.blobI]
+	b.ByteEnd = uint(w.n.Load())
+	if blockNum < b.BlockStart {
+		b.BlockStart = blockNum
+	}
+	if blockNum > b.BlockEnd {
+		b.BlockEnd = blockNum
+	}
+	b.BlockCount++
+
+	w.m.LastBlock = blockNum
+	w.m.Hash = hex.EncodeToString(w.h.Sum(nil))
+	w.m.save(w.namePrefix)
+}
+
+// rotate closes the current blob and opens the next one.
+func (w *writer) rotate() {
+	w.blobW0 = uint(w.n.Load())
+	w.blobI++
+	w.blobBlockStart = -1 // the new blob hasn't been given a block yet
+
+	assertNoError(w.blob.Close())
+	file, err := w.out.OpenBlob(int(w.blobI))
+	assertNoError(err)
+	w.blob = file
+}
+
+func (w *writer) Written() uint {
+	return uint(w.n.Load())
+}
+
+func (w *writer) Close() {
+	assertNoError(w.blob.Close())
+	assertNoError(w.out.Finalize(w.m))
+	w.m.save(w.namePrefix)
+}
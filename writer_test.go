@@ -0,0 +1,182 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalSinkResumeAppendsRatherThanTruncates(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "blocks-")
+	sink := newLocalSink(prefix)
+
+	w, err := sink.OpenBlob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w2, err := sink.OpenBlob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w2.Write([]byte("world")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := sink.ReadBlob(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "helloworld" {
+		t.Fatalf("got %q, want %q", data, "helloworld")
+	}
+}
+
+// TestWriterResumesFromManifest exercises newWriterWithCounter's resume path
+// against a manifest + localSink that already have a blob on disk, checking
+// that the byte counter and LastBlock pick up from exactly where the previous
+// run left off rather than from zero.
+func TestWriterResumesFromManifest(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "blocks-")
+
+	m := loadManifest(prefix, "http://example", 1, 0, 100, 1<<20)
+	sink := newLocalSink(prefix)
+	w := newWriterWithCounter(sink, prefix, m.BlobSize, m)
+
+	w.blobBlockStart = 0
+	w.curBlock = 0
+	if err := w.appendBytes([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	w.checkpoint(0)
+	w.Close()
+
+	m2 := loadManifest(prefix, "http://example", 1, 0, 100, 1<<20)
+	sink2 := newLocalSink(prefix)
+	w2 := newWriterWithCounter(sink2, prefix, m2.BlobSize, m2)
+
+	if got, want := w2.Written(), uint(3); got != want {
+		t.Fatalf("Written() after resume = %d, want %d", got, want)
+	}
+	if got, want := m2.LastBlock, int64(0); got != want {
+		t.Fatalf("LastBlock after resume = %d, want %d", got, want)
+	}
+}
+
+// fakeStreamingSink is a BlobSink that, like s3Sink and gcsSink, only
+// commits a blob once it's fully closed and doesn't implement blobReader.
+type fakeStreamingSink struct {
+	closed map[int][]byte
+}
+
+func (s *fakeStreamingSink) OpenBlob(index int) (io.WriteCloser, error) {
+	if s.closed == nil {
+		s.closed = map[int][]byte{}
+	}
+	return &fakeStreamingBlobWriter{sink: s, index: index}, nil
+}
+
+func (s *fakeStreamingSink) Finalize(*manifest) error { return nil }
+
+type fakeStreamingBlobWriter struct {
+	sink  *fakeStreamingSink
+	index int
+	buf   []byte
+}
+
+func (w *fakeStreamingBlobWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *fakeStreamingBlobWriter) Close() error {
+	w.sink.closed[w.index] = w.buf
+	return nil
+}
+
+// TestWriterRollsBackNonResumableSinkOnResume exercises the branch
+// newWriterWithCounter takes for sinks like s3Sink/gcsSink that can't hand
+// back a partially-written blob: it must roll the manifest back to the
+// start of the last (possibly incomplete) blob rather than trust ByteEnd,
+// since that blob may never have actually landed in the backend.
+func TestWriterRollsBackNonResumableSinkOnResume(t *testing.T) {
+	sink := &fakeStreamingSink{}
+	m := &manifest{
+		BlobSize:  1 << 20,
+		Blobs:     []blobRange{{ByteStart: 0, ByteEnd: 10, BlockStart: 0, BlockEnd: 3, BlockCount: 4}},
+		LastBlock: 3,
+	}
+
+	w := newWriterWithCounter(sink, "unused-prefix-", m.BlobSize, m)
+
+	if got, want := w.Written(), uint(0); got != want {
+		t.Fatalf("Written() after rollback = %d, want %d", got, want)
+	}
+	if got, want := m.LastBlock, int64(-1); got != want {
+		t.Fatalf("m.LastBlock after rollback = %d, want %d", got, want)
+	}
+	if got, want := len(m.Blobs), 0; got != want {
+		t.Fatalf("len(m.Blobs) after rollback = %d, want %d", got, want)
+	}
+}
+
+// TestWriterPersistsFinalizeIntoManifest guards against Close() only
+// updating w.m in memory: the manifest written by the last checkpoint()
+// call (the one before Finalize runs) doesn't yet have casSink's content
+// hashes, so Close() must save again after Finalize succeeds.
+func TestWriterPersistsFinalizeIntoManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifestPrefix := filepath.Join(dir, "state-")
+	sink := newCASSink(filepath.Join(dir, "cas"))
+
+	m := loadManifest(manifestPrefix, "http://example", 1, 0, 100, 1<<20)
+	w := newWriterWithCounter(sink, manifestPrefix, m.BlobSize, m)
+
+	w.blobBlockStart = 0
+	w.curBlock = 0
+	if err := w.appendBytes([]byte("blob-0-bytes")); err != nil {
+		t.Fatal(err)
+	}
+	w.checkpoint(0)
+	w.Close()
+
+	onDisk := loadManifest(manifestPrefix, "http://example", 1, 0, 100, 1<<20)
+	if len(onDisk.Blobs) != 1 || onDisk.Blobs[0].ContentHash == "" {
+		t.Fatalf("on-disk manifest missing ContentHash after Close: %+v", onDisk.Blobs)
+	}
+}
+
+// TestCheckpointTracksBlockRangeAsMinMax guards against regressing to
+// recording BlockStart/BlockEnd as the first/last call seen: --max mode's
+// unordered consume hands checkpoint blocks out of order, so they must be
+// tracked as the true min/max instead.
+func TestCheckpointTracksBlockRangeAsMinMax(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "blocks-")
+	m := loadManifest(prefix, "http://example", 1, 0, 100, 1<<20)
+	sink := newLocalSink(prefix)
+	w := newWriterWithCounter(sink, prefix, m.BlobSize, m)
+
+	for _, num := range []int64{50, 10, 30} {
+		if err := w.appendBytes([]byte("x")); err != nil {
+			t.Fatal(err)
+		}
+		w.checkpoint(num)
+	}
+
+	b := m.Blobs[0]
+	if b.BlockStart != 10 {
+		t.Errorf("BlockStart = %d, want 10 (the minimum block number seen)", b.BlockStart)
+	}
+	if b.BlockEnd != 50 {
+		t.Errorf("BlockEnd = %d, want 50 (the maximum block number seen)", b.BlockEnd)
+	}
+}